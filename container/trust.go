@@ -1,7 +1,9 @@
 package container
 
 import (
+	"encoding/json"
 	"os"
+	"os/exec"
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
@@ -19,11 +21,8 @@ import (
  * as available in that order
  */
 func EncodedAuth(ref string) (string, error) {
-	auth, err := firstValidAuth(ref, []authBackend{
-		authFromEnv(),
-		authFromDockerConfig(),
-	})
-	if err != nil {
+	auth, err := firstValidAuth(ref, authBackends())
+	if err == nil && auth != nil {
 		log.Debugf("Loaded auth credentials %s for %s", auth, ref)
 		return EncodeAuth(auth)
 	}
@@ -33,6 +32,20 @@ func EncodedAuth(ref string) (string, error) {
 // authBackend encapsulates a function that resolves registry credentials.
 type authBackend func(string) (*types.AuthConfig, error)
 
+// authBackends returns every registered auth backend, in resolution order:
+// explicit env vars and pull secrets first, then cloud-provider metadata
+// endpoints, falling back to the local Docker config/credential store.
+func authBackends() []authBackend {
+	return []authBackend{
+		authFromEnv(),
+		authFromPullSecrets(),
+		authFromECR(),
+		authFromGCR(),
+		authFromACR(),
+		authFromDockerConfig(),
+	}
+}
+
 // firstValidAuth tries a list of auth backends, returning first error or AuthConfig
 func firstValidAuth(repo string, backends []authBackend) (*types.AuthConfig, error) {
 	for _, backend := range backends {
@@ -44,23 +57,76 @@ func firstValidAuth(repo string, backends []authBackend) (*types.AuthConfig, err
 	return nil, nil
 }
 
-// authFromEnv generates an authBackend via ENV variables
+// registryAuthsEnv names an env var holding an inline JSON map of
+// {host: {username, password}}, letting a single Watchtower instance
+// update containers spanning several private registries.
+const registryAuthsEnv = "WATCHTOWER_REGISTRY_AUTHS"
+
+// authFromEnv generates an authBackend via ENV variables. It honors a
+// single REPO_USER/REPO_PASS pair, per-registry REPO_USER_<HOST>/
+// REPO_PASS_<HOST> pairs (with "." and ":" replaced by "_"), and an
+// inline WATCHTOWER_REGISTRY_AUTHS JSON map, resolving the right entry
+// for ref the same way docker-cli resolves AuthConfigs[server].
 func authFromEnv() authBackend {
-	return func(string) (*types.AuthConfig, error) {
+	return func(ref string) (*types.AuthConfig, error) {
+		server, err := ParseServerAddress(ref)
+		if err != nil {
+			return nil, err
+		}
+
+		if auth, ok := registryAuthFromJSON(os.Getenv(registryAuthsEnv), server); ok {
+			return &auth, nil
+		}
+
+		if username, password := os.Getenv(envKeyFor("REPO_USER", server)), os.Getenv(envKeyFor("REPO_PASS", server)); username != "" && password != "" {
+			return &types.AuthConfig{Username: username, Password: password}, nil
+		}
+
 		username := os.Getenv("REPO_USER")
 		password := os.Getenv("REPO_PASS")
-		if username != "" && password != "" {
-			auth := types.AuthConfig{
-				Username: username,
-				Password: password,
-			}
-			return &auth, nil
-		} else {
+		if username == "" || password == "" {
 			return nil, nil
 		}
+		return &types.AuthConfig{Username: username, Password: password}, nil
 	}
 }
 
+// envKeyFor builds a per-registry env var name such as REPO_USER_GHCR_IO
+// from a base name and a server address, replacing "." and ":" with "_"
+// to keep it a valid env var name.
+func envKeyFor(base, server string) string {
+	replacer := strings.NewReplacer(".", "_", ":", "_")
+	return base + "_" + strings.ToUpper(replacer.Replace(server))
+}
+
+// registryAuthFromJSON looks up server in a WATCHTOWER_REGISTRY_AUTHS-style
+// JSON map of {host: {username, password}}, matching wildcard/host-prefix
+// keys (e.g. "*.gcr.io") the same way the pull-secrets backend does.
+func registryAuthFromJSON(raw, server string) (types.AuthConfig, bool) {
+	if raw == "" {
+		return types.AuthConfig{}, false
+	}
+
+	var auths map[string]struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.Unmarshal([]byte(raw), &auths); err != nil {
+		log.Errorf("Unable to parse %s: %s", registryAuthsEnv, err)
+		return types.AuthConfig{}, false
+	}
+
+	if entry, ok := auths[server]; ok {
+		return types.AuthConfig{Username: entry.Username, Password: entry.Password}, true
+	}
+	for key, entry := range auths {
+		if matchRegistryHost(key, server) {
+			return types.AuthConfig{Username: entry.Username, Password: entry.Password}, true
+		}
+	}
+	return types.AuthConfig{}, false
+}
+
 // authFromDockerConfig parses a Docker configuration for auth information
 func authFromDockerConfig() authBackend {
 	return func(ref string) (*types.AuthConfig, error) {
@@ -85,6 +151,11 @@ func authFromDockerConfig() authBackend {
 }
 
 
+// ParseServerAddress extracts the registry host from ref. It intentionally
+// stays a plain host extractor and does not itself match against
+// wildcard/host-prefix keys (e.g. "*.gcr.io") from a config's known
+// registries; that matching is a property of each host-keyed lookup (see
+// matchRegistryHost) rather than of turning a ref into a host.
 func ParseServerAddress(ref string) (string, error) {
 	repository, _, err := reference.Parse(ref)
 	if err != nil {
@@ -94,19 +165,74 @@ func ParseServerAddress(ref string) (string, error) {
 	return parts[0], nil
 }
 
+// matchRegistryHost reports whether key names server, either exactly or as
+// a wildcard/host-prefix pattern such as "*.gcr.io" matching any host under
+// that domain. It's shared by every auth backend that resolves credentials
+// from a host-keyed map (imagePullSecrets, WATCHTOWER_REGISTRY_AUTHS, ...)
+// so wildcard keys behave consistently across backends.
+func matchRegistryHost(key, server string) bool {
+	if key == server {
+		return true
+	}
+	return strings.HasPrefix(key, "*.") && strings.HasSuffix(server, key[1:])
+}
+
 // CredentialsStore returns a new credentials store based
-// on the settings provided in the configuration file.
+// on the settings provided in the configuration file. If the
+// configuration file does not name a store or a per-registry helper
+// and contains no plaintext auths of its own, a platform-appropriate
+// default store (matching Docker's own DetectDefaultStore behaviour) is
+// used instead, provided its docker-credential-<store> binary is actually
+// on PATH.
 func CredentialsStore(configFile configfile.ConfigFile, server string) credentials.Store {
+	if helper, ok := configFile.CredentialHelpers[server]; ok {
+		return credentials.NewNativeStore(&configFile, helper)
+	}
 	if configFile.CredentialsStore != "" {
 		return credentials.NewNativeStore(&configFile, configFile.CredentialsStore)
 	}
-	helper, ok := configFile.CredentialHelpers[server]
-	if ok {
-		return credentials.NewNativeStore(&configFile, helper)
+	if len(configFile.AuthConfigs) == 0 {
+		if store := defaultCredentialsStore(); store != "" && credentialHelperOnPath(store) {
+			return credentials.NewNativeStore(&configFile, store)
+		}
 	}
 	return credentials.NewFileStore(&configFile)
 }
 
+// credentialHelperOnPath reports whether the docker-credential-<store>
+// binary the native store would exec is actually installed, the same
+// probe Docker's own DetectDefaultStore does before assuming a platform
+// default is usable.
+func credentialHelperOnPath(store string) bool {
+	_, err := exec.LookPath("docker-credential-" + store)
+	return err == nil
+}
+
+// GetAllCredentials returns every auth entry known to the configured
+// credentials store, plus one entry for each registry with a per-registry
+// credHelpers entry, keyed by registry server address. It mirrors
+// CredentialsStore's store selection so a future "docker build"-style
+// flow can hand the daemon all known auths at once instead of resolving
+// a single server.
+func GetAllCredentials(configFile configfile.ConfigFile) (map[string]types.AuthConfig, error) {
+	stored, err := CredentialsStore(configFile, "").GetAll()
+	if err != nil {
+		return nil, err
+	}
+	auths := make(map[string]types.AuthConfig, len(stored))
+	for server, auth := range stored {
+		auths[server] = auth
+	}
+	for server := range configFile.CredentialHelpers {
+		auth, err := CredentialsStore(configFile, server).Get(server)
+		if err != nil {
+			return nil, err
+		}
+		auths[server] = auth
+	}
+	return auths, nil
+}
+
 /*
  * Base64 encode an AuthConfig struct for transmission over HTTP
  */
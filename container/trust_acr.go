@@ -0,0 +1,171 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// acrHostPattern matches Azure Container Registry hostnames, e.g.
+// myregistry.azurecr.io
+var acrHostPattern = regexp.MustCompile(`\.azurecr\.io$`)
+
+var acrTokens = newCloudTokenCache()
+
+// authFromACR generates an authBackend that exchanges an Azure AD access
+// token (from a service principal configured via the standard AZURE_*
+// environment variables, or the VM/container's managed identity) for an
+// ACR refresh token at the registry's /oauth2/exchange endpoint, and
+// returns it as the conventional ACR anonymous-identity username. Both
+// token sources are reached with plain HTTP calls rather than the Azure SDK.
+func authFromACR() authBackend {
+	return func(ref string) (*types.AuthConfig, error) {
+		server, err := ParseServerAddress(ref)
+		if err != nil {
+			return nil, err
+		}
+		if !acrHostPattern.MatchString(server) {
+			return nil, nil
+		}
+
+		if auth, ok := acrTokens.get(server); ok {
+			return auth, nil
+		}
+
+		accessToken, err := acrAccessToken()
+		if err != nil {
+			return nil, err
+		}
+		if accessToken == "" {
+			return nil, nil
+		}
+
+		refreshToken, expiry, err := exchangeACRRefreshToken(server, accessToken)
+		if err != nil {
+			return nil, err
+		}
+
+		auth := &types.AuthConfig{
+			Username:      "00000000-0000-0000-0000-000000000000",
+			Password:      refreshToken,
+			IdentityToken: refreshToken,
+			ServerAddress: server,
+		}
+		acrTokens.set(server, auth, expiry)
+		return auth, nil
+	}
+}
+
+// acrAccessToken resolves an Azure AD access token for the
+// management.azure.com resource, preferring a service principal configured
+// via AZURE_TENANT_ID/AZURE_CLIENT_ID/AZURE_CLIENT_SECRET and falling back
+// to the host's managed identity. Returns "" if neither is available.
+func acrAccessToken() (string, error) {
+	token, err := acrServicePrincipalToken()
+	if err != nil {
+		return "", err
+	}
+	if token != "" {
+		return token, nil
+	}
+	return acrManagedIdentityToken()
+}
+
+// acrServicePrincipalToken trades a service principal's client credentials
+// for an access token via Azure AD's OAuth2 token endpoint. It returns
+// ("", nil) when the AZURE_* environment variables aren't set.
+func acrServicePrincipalToken() (string, error) {
+	tenantID := os.Getenv("AZURE_TENANT_ID")
+	clientID := os.Getenv("AZURE_CLIENT_ID")
+	clientSecret := os.Getenv("AZURE_CLIENT_SECRET")
+	if tenantID == "" || clientID == "" || clientSecret == "" {
+		return "", nil
+	}
+
+	resp, err := http.PostForm(fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/token", tenantID), url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"resource":      {"https://management.azure.com/"},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Azure AD service-principal token request failed: %s", resp.Status)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	return body.AccessToken, nil
+}
+
+// acrManagedIdentityToken fetches an access token for the host's managed
+// identity from the Azure Instance Metadata Service. It returns ("", nil)
+// if IMDS isn't reachable (e.g. not running on Azure).
+func acrManagedIdentityToken() (string, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://169.254.169.254/metadata/identity/oauth2/token?api-version=2018-02-01&resource=https://management.azure.com/", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	return body.AccessToken, nil
+}
+
+// exchangeACRRefreshToken trades an Azure AD access token for an ACR
+// refresh token good for pulling from the given registry.
+func exchangeACRRefreshToken(server, accessToken string) (string, time.Time, error) {
+	form := url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {server},
+		"access_token": {accessToken},
+	}
+	resp, err := http.PostForm(fmt.Sprintf("https://%s/oauth2/exchange", server), form)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("ACR token exchange with %s failed: %s", server, resp.Status)
+	}
+
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", time.Time{}, err
+	}
+
+	// ACR refresh tokens aren't JWTs with a fixed lifetime in the exchange
+	// response; assume Azure AD's default token lifetime of an hour and
+	// re-exchange slightly before then.
+	return body.RefreshToken, time.Now().Add(time.Hour), nil
+}
@@ -0,0 +1,30 @@
+package container
+
+import "testing"
+
+func TestAcrHostPattern(t *testing.T) {
+	cases := []struct {
+		host string
+		want bool
+	}{
+		{"myregistry.azurecr.io", true},
+		{"sub.myregistry.azurecr.io", true},
+		{"notazurecr.io", false},
+		{"docker.io", false},
+	}
+
+	for _, c := range cases {
+		if got := acrHostPattern.MatchString(c.host); got != c.want {
+			t.Errorf("acrHostPattern.MatchString(%q) = %v, want %v", c.host, got, c.want)
+		}
+	}
+}
+
+// TestAuthFromACRHostGating checks that non-ACR hosts are rejected before
+// any credential lookup or network call is attempted.
+func TestAuthFromACRHostGating(t *testing.T) {
+	auth, err := authFromACR()("docker.io/library/ubuntu")
+	if err != nil || auth != nil {
+		t.Errorf("authFromACR()(non-ACR ref) = (%v, %v), want (nil, nil)", auth, err)
+	}
+}
@@ -0,0 +1,44 @@
+package container
+
+import (
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// cloudTokenCache caches credentials minted by cloud-provider credential
+// backends (ECR, GCR, ACR), keyed by registry host, so a periodic
+// Watchtower scan doesn't hammer the provider's token endpoint on every
+// tick.
+type cloudTokenCache struct {
+	mu      sync.Mutex
+	entries map[string]cloudTokenEntry
+}
+
+type cloudTokenEntry struct {
+	auth   *types.AuthConfig
+	expiry time.Time
+}
+
+func newCloudTokenCache() *cloudTokenCache {
+	return &cloudTokenCache{entries: map[string]cloudTokenEntry{}}
+}
+
+// get returns a still-valid cached auth for key, leaving a margin before
+// the real expiry so a token doesn't go stale mid-pull.
+func (c *cloudTokenCache) get(key string) (*types.AuthConfig, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().Add(time.Minute).After(entry.expiry) {
+		return nil, false
+	}
+	return entry.auth, true
+}
+
+func (c *cloudTokenCache) set(key string, auth *types.AuthConfig, expiry time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cloudTokenEntry{auth: auth, expiry: expiry}
+}
@@ -0,0 +1,34 @@
+package container
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestCloudTokenCache(t *testing.T) {
+	cache := newCloudTokenCache()
+	auth := &types.AuthConfig{Username: "oauth2accesstoken", Password: "token"}
+
+	if _, ok := cache.get("missing"); ok {
+		t.Error("get on empty cache should miss")
+	}
+
+	cache.set("server", auth, time.Now().Add(time.Hour))
+	if got, ok := cache.get("server"); !ok || got != auth {
+		t.Errorf("get(server) = (%v, %v), want (%v, true)", got, ok, auth)
+	}
+
+	// Within the one-minute expiry margin, a cached entry should already
+	// be treated as unusable even though it hasn't technically expired.
+	cache.set("about-to-expire", auth, time.Now().Add(30*time.Second))
+	if _, ok := cache.get("about-to-expire"); ok {
+		t.Error("get should miss for an entry inside the expiry margin")
+	}
+
+	cache.set("expired", auth, time.Now().Add(-time.Minute))
+	if _, ok := cache.get("expired"); ok {
+		t.Error("get should miss for an expired entry")
+	}
+}
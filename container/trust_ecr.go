@@ -0,0 +1,267 @@
+package container
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/docker/api/types"
+)
+
+// ecrHostPattern matches Amazon ECR registry hostnames, e.g.
+// 123456789012.dkr.ecr.us-east-1.amazonaws.com
+var ecrHostPattern = regexp.MustCompile(`^\d+\.dkr\.ecr\.[a-z0-9-]+\.amazonaws\.com$`)
+
+var ecrTokens = newCloudTokenCache()
+
+// authFromECR generates an authBackend that resolves credentials for Amazon
+// ECR hosts from the ambient IAM role or instance profile, so users don't
+// need to install docker-credential-ecr-login for Watchtower to pull
+// private images. It signs the ECR GetAuthorizationToken request itself
+// (SigV4) against whatever credentials are available, rather than pulling
+// in the AWS SDK.
+func authFromECR() authBackend {
+	return func(ref string) (*types.AuthConfig, error) {
+		server, err := ParseServerAddress(ref)
+		if err != nil {
+			return nil, err
+		}
+		if !ecrHostPattern.MatchString(server) {
+			return nil, nil
+		}
+
+		if auth, ok := ecrTokens.get(server); ok {
+			return auth, nil
+		}
+
+		creds, err := awsCredentials()
+		if err != nil {
+			return nil, err
+		}
+		if creds == nil {
+			return nil, nil
+		}
+
+		token, expiry, err := ecrGetAuthorizationToken(ecrRegion(server), creds)
+		if err != nil {
+			log.Errorf("Unable to fetch ECR authorization token for %s: %s", server, err)
+			return nil, err
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, err
+		}
+		userPass := strings.SplitN(string(decoded), ":", 2)
+		if len(userPass) != 2 {
+			return nil, nil
+		}
+
+		auth := &types.AuthConfig{
+			Username:      userPass[0],
+			Password:      userPass[1],
+			ServerAddress: server,
+		}
+		ecrTokens.set(server, auth, expiry)
+		return auth, nil
+	}
+}
+
+// ecrRegion extracts the region component from an ECR hostname, e.g.
+// "us-east-1" from "123456789012.dkr.ecr.us-east-1.amazonaws.com".
+func ecrRegion(host string) string {
+	parts := strings.Split(host, ".")
+	if len(parts) >= 4 {
+		return parts[3]
+	}
+	return ""
+}
+
+// awsCreds holds the access key/secret/session token used to sign AWS
+// requests.
+type awsCreds struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// awsCredentials resolves AWS credentials from the standard environment
+// variables first, falling back to the EC2/ECS instance metadata service
+// (IMDSv2), mirroring the order the AWS SDK's default credential chain
+// checks them in. It returns (nil, nil) if no credentials are available.
+func awsCredentials() (*awsCreds, error) {
+	if accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); accessKey != "" && secretKey != "" {
+		return &awsCreds{
+			AccessKeyID:     accessKey,
+			SecretAccessKey: secretKey,
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+	return ec2InstanceCredentials()
+}
+
+// ec2InstanceCredentials fetches temporary credentials for the instance's
+// attached IAM role from the IMDSv2 metadata service. It returns (nil, nil)
+// if the metadata service isn't reachable (e.g. not running on EC2/ECS).
+func ec2InstanceCredentials() (*awsCreds, error) {
+	client := &http.Client{Timeout: 2 * time.Second}
+
+	tokenReq, err := http.NewRequest(http.MethodPut, "http://169.254.169.254/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	tokenReq.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	tokenResp, err := client.Do(tokenReq)
+	if err != nil {
+		return nil, nil
+	}
+	defer tokenResp.Body.Close()
+	token, err := ioutil.ReadAll(tokenResp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	roleReq, _ := http.NewRequest(http.MethodGet, "http://169.254.169.254/latest/meta-data/iam/security-credentials/", nil)
+	roleReq.Header.Set("X-aws-ec2-metadata-token", string(token))
+	roleResp, err := client.Do(roleReq)
+	if err != nil || roleResp.StatusCode != http.StatusOK {
+		if roleResp != nil {
+			roleResp.Body.Close()
+		}
+		return nil, nil
+	}
+	role, err := ioutil.ReadAll(roleResp.Body)
+	roleResp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	credsReq, _ := http.NewRequest(http.MethodGet, "http://169.254.169.254/latest/meta-data/iam/security-credentials/"+strings.TrimSpace(string(role)), nil)
+	credsReq.Header.Set("X-aws-ec2-metadata-token", string(token))
+	credsResp, err := client.Do(credsReq)
+	if err != nil {
+		return nil, err
+	}
+	defer credsResp.Body.Close()
+
+	var body struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string `json:"SecretAccessKey"`
+		Token           string `json:"Token"`
+	}
+	if err := json.NewDecoder(credsResp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return &awsCreds{
+		AccessKeyID:     body.AccessKeyID,
+		SecretAccessKey: body.SecretAccessKey,
+		SessionToken:    body.Token,
+	}, nil
+}
+
+// ecrGetAuthorizationToken calls ECR's GetAuthorizationToken API, signing
+// the request with SigV4 by hand so this package doesn't need to pull in
+// the AWS SDK for a single call.
+func ecrGetAuthorizationToken(region string, creds *awsCreds) (token string, expiry time.Time, err error) {
+	host := fmt.Sprintf("ecr.%s.amazonaws.com", region)
+	body := []byte("{}")
+
+	req, err := http.NewRequest(http.MethodPost, "https://"+host+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken")
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	signAWSRequestV4(req, body, region, "ecr", creds)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("ECR GetAuthorizationToken failed: %s", resp.Status)
+	}
+
+	var out struct {
+		AuthorizationData []struct {
+			AuthorizationToken string `json:"authorizationToken"`
+			ExpiresAt          int64  `json:"expiresAt"`
+		} `json:"authorizationData"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", time.Time{}, err
+	}
+	if len(out.AuthorizationData) == 0 {
+		return "", time.Time{}, fmt.Errorf("ECR returned no authorization data")
+	}
+	data := out.AuthorizationData[0]
+	return data.AuthorizationToken, time.Unix(data.ExpiresAt, 0), nil
+}
+
+// signAWSRequestV4 adds the SigV4 headers AWS requires to authenticate req,
+// covering only what GetAuthorizationToken needs (no query-string signing,
+// no chunked payloads).
+func signAWSRequestV4(req *http.Request, body []byte, region, service string, creds *awsCreds) {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("Host", req.Host)
+
+	payloadHash := sha256Hex(body)
+	canonicalHeaders := fmt.Sprintf("content-type:%s\nhost:%s\nx-amz-date:%s\nx-amz-target:%s\n",
+		req.Header.Get("Content-Type"), req.Host, amzDate, req.Header.Get("X-Amz-Target"))
+	signedHeaders := "content-type;host;x-amz-date;x-amz-target"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		"",
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	credentialScope := fmt.Sprintf("%s/%s/%s/aws4_request", dateStamp, region, service)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		credentialScope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256(hmacSHA256(hmacSHA256(hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), dateStamp), region), service), "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, credentialScope, signedHeaders, signature,
+	))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
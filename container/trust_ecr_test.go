@@ -0,0 +1,29 @@
+package container
+
+import "testing"
+
+func TestEcrRegion(t *testing.T) {
+	cases := []struct {
+		host string
+		want string
+	}{
+		{"123456789012.dkr.ecr.us-east-1.amazonaws.com", "us-east-1"},
+		{"123456789012.dkr.ecr.eu-central-1.amazonaws.com", "eu-central-1"},
+		{"docker.io", ""},
+	}
+
+	for _, c := range cases {
+		if got := ecrRegion(c.host); got != c.want {
+			t.Errorf("ecrRegion(%q) = %q, want %q", c.host, got, c.want)
+		}
+	}
+}
+
+// TestAuthFromECRHostGating checks that non-ECR hosts are rejected before
+// any credential lookup or network call is attempted.
+func TestAuthFromECRHostGating(t *testing.T) {
+	auth, err := authFromECR()("docker.io/library/ubuntu")
+	if err != nil || auth != nil {
+		t.Errorf("authFromECR()(non-ECR ref) = (%v, %v), want (nil, nil)", auth, err)
+	}
+}
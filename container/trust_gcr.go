@@ -0,0 +1,196 @@
+package container
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// gcrHostSuffixes matches Google Container Registry and Artifact Registry
+// hostnames, e.g. gcr.io, us.gcr.io, us-docker.pkg.dev.
+var gcrHostSuffixes = []string{"gcr.io", "pkg.dev"}
+
+var gcrTokens = newCloudTokenCache()
+
+// gcrScope is the OAuth2 scope requested for pulling images from GCR/AR.
+const gcrScope = "https://www.googleapis.com/auth/devstorage.read_only"
+
+// authFromGCR generates an authBackend that mints a short-lived OAuth2
+// access token for GCR/Artifact Registry hosts, using GCE metadata or a
+// GOOGLE_APPLICATION_CREDENTIALS service-account key, and returns it as
+// the conventional "oauth2accesstoken" username. Both token sources are
+// reached with plain HTTP/crypto calls rather than the Google Cloud SDK.
+func authFromGCR() authBackend {
+	return func(ref string) (*types.AuthConfig, error) {
+		server, err := ParseServerAddress(ref)
+		if err != nil {
+			return nil, err
+		}
+		if !isGCRHost(server) {
+			return nil, nil
+		}
+
+		if auth, ok := gcrTokens.get(server); ok {
+			return auth, nil
+		}
+
+		token, expiry, err := gceMetadataAccessToken()
+		if err != nil {
+			return nil, err
+		}
+		if token == "" {
+			token, expiry, err = serviceAccountAccessToken(os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"))
+			if err != nil {
+				return nil, err
+			}
+		}
+		if token == "" {
+			return nil, nil
+		}
+
+		auth := &types.AuthConfig{
+			Username:      "oauth2accesstoken",
+			Password:      token,
+			ServerAddress: server,
+		}
+		gcrTokens.set(server, auth, expiry)
+		return auth, nil
+	}
+}
+
+func isGCRHost(host string) bool {
+	for _, suffix := range gcrHostSuffixes {
+		if host == suffix || strings.HasSuffix(host, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// gceMetadataAccessToken fetches an access token for the instance's
+// attached service account from the GCE metadata server. It returns
+// ("", zero, nil) if the metadata server isn't reachable (e.g. not
+// running on GCE).
+func gceMetadataAccessToken() (string, time.Time, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, nil
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", time.Time{}, err
+	}
+	return body.AccessToken, time.Now().Add(time.Duration(body.ExpiresIn) * time.Second), nil
+}
+
+// serviceAccountAccessToken exchanges a GOOGLE_APPLICATION_CREDENTIALS
+// service-account key file for an OAuth2 access token, by self-signing a
+// JWT assertion and trading it at the key's token URI. Returns ("", zero,
+// nil) if keyPath is empty.
+func serviceAccountAccessToken(keyPath string) (string, time.Time, error) {
+	if keyPath == "" {
+		return "", time.Time{}, nil
+	}
+
+	data, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	var key struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return "", time.Time{}, err
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	assertion, err := signGoogleJWT(key.ClientEmail, key.PrivateKey, key.TokenURI)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	resp, err := http.PostForm(key.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("Google token exchange failed: %s", resp.Status)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", time.Time{}, err
+	}
+	return body.AccessToken, time.Now().Add(time.Duration(body.ExpiresIn) * time.Second), nil
+}
+
+// signGoogleJWT builds and RS256-signs a self-issued JWT assertion for the
+// jwt-bearer grant, as described by Google's OAuth2 service-account flow.
+func signGoogleJWT(clientEmail, privateKeyPEM, audience string) (string, error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return "", fmt.Errorf("invalid private key in service account key file")
+	}
+	parsedKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	rsaKey, ok := parsedKey.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("service account private key is not RSA")
+	}
+
+	now := time.Now()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims := fmt.Sprintf(`{"iss":%q,"scope":%q,"aud":%q,"iat":%d,"exp":%d}`,
+		clientEmail, gcrScope, audience, now.Unix(), now.Add(time.Hour).Unix())
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString([]byte(claims))
+
+	hashed := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,33 @@
+package container
+
+import "testing"
+
+func TestIsGCRHost(t *testing.T) {
+	cases := []struct {
+		host string
+		want bool
+	}{
+		{"gcr.io", true},
+		{"us.gcr.io", true},
+		{"us-docker.pkg.dev", true},
+		{"pkg.dev", true},
+		{"notgcr.io", false},
+		{"evilpkg.dev", false},
+		{"docker.io", false},
+	}
+
+	for _, c := range cases {
+		if got := isGCRHost(c.host); got != c.want {
+			t.Errorf("isGCRHost(%q) = %v, want %v", c.host, got, c.want)
+		}
+	}
+}
+
+// TestAuthFromGCRHostGating checks that non-GCR hosts are rejected before
+// any credential lookup or network call is attempted.
+func TestAuthFromGCRHostGating(t *testing.T) {
+	auth, err := authFromGCR()("docker.io/library/ubuntu")
+	if err != nil || auth != nil {
+		t.Errorf("authFromGCR()(non-GCR ref) = (%v, %v), want (nil, nil)", auth, err)
+	}
+}
@@ -0,0 +1,111 @@
+package container
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/docker/api/types"
+)
+
+// defaultPullSecretPath is where Kubernetes mounts an imagePullSecret of
+// type kubernetes.io/dockerconfigjson when it is wired up as a volume, e.g.
+// via a Watchtower pod/sidecar spec.
+const defaultPullSecretPath = "/var/run/secrets/watchtower/config.json"
+
+// pullSecretsEnv names the environment variable holding one or more paths
+// (separated by os.PathListSeparator) to dockerconfigjson documents, as
+// produced by `kubectl create secret docker-registry`.
+const pullSecretsEnv = "WATCHTOWER_PULL_SECRETS"
+
+// dockerConfigAuthEntry is a single registry entry within a
+// dockerconfigjson document's "auths" map.
+type dockerConfigAuthEntry struct {
+	Auth string `json:"auth"`
+}
+
+// dockerConfigJSON is the subset of the Kubernetes
+// kubernetes.io/dockerconfigjson secret shape that we care about:
+// {"auths": {"registry": {"auth": "base64(user:pass)"}}}
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigAuthEntry `json:"auths"`
+}
+
+// authFromPullSecrets generates an authBackend that resolves credentials
+// from mounted Kubernetes imagePullSecrets, so a single secret can supply
+// auth for every registry a Watchtower pod needs to pull from.
+func authFromPullSecrets() authBackend {
+	return func(ref string) (*types.AuthConfig, error) {
+		server, err := ParseServerAddress(ref)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, path := range pullSecretPaths() {
+			data, err := ioutil.ReadFile(path)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				log.Errorf("Unable to read pull secret %s: %s", path, err)
+				continue
+			}
+
+			var config dockerConfigJSON
+			if err := json.Unmarshal(data, &config); err != nil {
+				log.Errorf("Unable to parse pull secret %s: %s", path, err)
+				continue
+			}
+
+			entry, ok := matchDockerConfigAuth(config.Auths, server)
+			if !ok {
+				continue
+			}
+
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				log.Errorf("Unable to decode auth for %s in %s: %s", server, path, err)
+				continue
+			}
+			userPass := strings.SplitN(string(decoded), ":", 2)
+			if len(userPass) != 2 {
+				continue
+			}
+
+			return &types.AuthConfig{
+				Username:      userPass[0],
+				Password:      userPass[1],
+				ServerAddress: server,
+			}, nil
+		}
+		return nil, nil
+	}
+}
+
+// pullSecretPaths returns the configured pull secret file locations, falling
+// back to the conventional mounted path when WATCHTOWER_PULL_SECRETS is unset.
+func pullSecretPaths() []string {
+	if paths := os.Getenv(pullSecretsEnv); paths != "" {
+		return strings.Split(paths, string(os.PathListSeparator))
+	}
+	return []string{defaultPullSecretPath}
+}
+
+// matchDockerConfigAuth looks up server in a dockerconfigjson auths map,
+// via matchRegistryHost, so a wildcard/host-prefix key such as "*.gcr.io"
+// covers every host under a registry domain the same way it does for
+// WATCHTOWER_REGISTRY_AUTHS.
+func matchDockerConfigAuth(auths map[string]dockerConfigAuthEntry, server string) (dockerConfigAuthEntry, bool) {
+	if entry, ok := auths[server]; ok {
+		return entry, true
+	}
+	for key, entry := range auths {
+		if matchRegistryHost(key, server) {
+			return entry, true
+		}
+	}
+	return dockerConfigAuthEntry{}, false
+}
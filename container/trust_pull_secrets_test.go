@@ -0,0 +1,120 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchDockerConfigAuth(t *testing.T) {
+	auths := map[string]dockerConfigAuthEntry{
+		"ghcr.io":  {Auth: "exact"},
+		"*.gcr.io": {Auth: "wildcard"},
+	}
+
+	cases := []struct {
+		server    string
+		wantAuth  string
+		wantFound bool
+	}{
+		{"ghcr.io", "exact", true},
+		{"us.gcr.io", "wildcard", true},
+		{"eu.gcr.io", "wildcard", true},
+		{"notgcr.io", "", false},
+		{"docker.io", "", false},
+	}
+
+	for _, c := range cases {
+		entry, ok := matchDockerConfigAuth(auths, c.server)
+		if ok != c.wantFound {
+			t.Errorf("matchDockerConfigAuth(%q) found = %v, want %v", c.server, ok, c.wantFound)
+			continue
+		}
+		if ok && entry.Auth != c.wantAuth {
+			t.Errorf("matchDockerConfigAuth(%q) = %q, want %q", c.server, entry.Auth, c.wantAuth)
+		}
+	}
+}
+
+func writePullSecret(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile(%s): %s", path, err)
+	}
+	return path
+}
+
+func TestAuthFromPullSecrets(t *testing.T) {
+	dir := t.TempDir()
+
+	good := writePullSecret(t, dir, "good.json", `{"auths":{"ghcr.io":{"auth":"dXNlcjpwYXNz"}}}`)
+	t.Setenv(pullSecretsEnv, good)
+
+	auth, err := authFromPullSecrets()("ghcr.io/library/ubuntu")
+	if err != nil {
+		t.Fatalf("authFromPullSecrets() error = %s", err)
+	}
+	if auth == nil || auth.Username != "user" || auth.Password != "pass" {
+		t.Errorf("authFromPullSecrets() = %+v, want Username=user Password=pass", auth)
+	}
+}
+
+func TestAuthFromPullSecretsNoMatch(t *testing.T) {
+	dir := t.TempDir()
+	good := writePullSecret(t, dir, "good.json", `{"auths":{"ghcr.io":{"auth":"dXNlcjpwYXNz"}}}`)
+	t.Setenv(pullSecretsEnv, good)
+
+	auth, err := authFromPullSecrets()("docker.io/library/ubuntu")
+	if err != nil || auth != nil {
+		t.Errorf("authFromPullSecrets() for unlisted registry = (%v, %v), want (nil, nil)", auth, err)
+	}
+}
+
+func TestAuthFromPullSecretsMissingFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(pullSecretsEnv, filepath.Join(dir, "does-not-exist.json"))
+
+	auth, err := authFromPullSecrets()("ghcr.io/library/ubuntu")
+	if err != nil || auth != nil {
+		t.Errorf("authFromPullSecrets() with missing file = (%v, %v), want (nil, nil)", auth, err)
+	}
+}
+
+func TestAuthFromPullSecretsMalformedJSON(t *testing.T) {
+	dir := t.TempDir()
+	bad := writePullSecret(t, dir, "bad.json", `not json`)
+	t.Setenv(pullSecretsEnv, bad)
+
+	auth, err := authFromPullSecrets()("ghcr.io/library/ubuntu")
+	if err != nil || auth != nil {
+		t.Errorf("authFromPullSecrets() with malformed JSON = (%v, %v), want (nil, nil)", auth, err)
+	}
+}
+
+func TestAuthFromPullSecretsMalformedBase64(t *testing.T) {
+	dir := t.TempDir()
+	bad := writePullSecret(t, dir, "bad.json", `{"auths":{"ghcr.io":{"auth":"not-base64!!"}}}`)
+	t.Setenv(pullSecretsEnv, bad)
+
+	auth, err := authFromPullSecrets()("ghcr.io/library/ubuntu")
+	if err != nil || auth != nil {
+		t.Errorf("authFromPullSecrets() with malformed base64 = (%v, %v), want (nil, nil)", auth, err)
+	}
+}
+
+func TestAuthFromPullSecretsMultiplePaths(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.json")
+	good := writePullSecret(t, dir, "good.json", `{"auths":{"*.gcr.io":{"auth":"dXNlcjpwYXNz"}}}`)
+	t.Setenv(pullSecretsEnv, missing+string(os.PathListSeparator)+good)
+
+	auth, err := authFromPullSecrets()("us.gcr.io/project/image")
+	if err != nil {
+		t.Fatalf("authFromPullSecrets() error = %s", err)
+	}
+	if auth == nil || auth.Username != "user" {
+		t.Errorf("authFromPullSecrets() across multiple paths = %+v, want Username=user", auth)
+	}
+}
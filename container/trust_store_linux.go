@@ -0,0 +1,10 @@
+package container
+
+// defaultCredentialsStore returns the name of the credential helper Docker
+// itself falls back to on Linux when neither credsStore nor credHelpers is
+// configured. secretservice requires a running D-Bus session, which isn't
+// always available (e.g. headless Watchtower containers), so callers should
+// treat a failure to exec the helper as "no stored auth" rather than fatal.
+func defaultCredentialsStore() string {
+	return "secretservice"
+}
@@ -0,0 +1,9 @@
+// +build !linux,!darwin,!windows
+
+package container
+
+// defaultCredentialsStore returns "" on platforms Docker has no native
+// credential helper for, leaving the plaintext file store in place.
+func defaultCredentialsStore() string {
+	return ""
+}
@@ -0,0 +1,8 @@
+package container
+
+// defaultCredentialsStore returns the name of the credential helper Docker
+// itself falls back to on Windows when neither credsStore nor credHelpers is
+// configured.
+func defaultCredentialsStore() string {
+	return "wincred"
+}
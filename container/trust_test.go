@@ -0,0 +1,120 @@
+package container
+
+import "testing"
+
+func TestEnvKeyFor(t *testing.T) {
+	cases := []struct {
+		base   string
+		server string
+		want   string
+	}{
+		{"REPO_USER", "ghcr.io", "REPO_USER_GHCR_IO"},
+		{"REPO_PASS", "localhost:5000", "REPO_PASS_LOCALHOST_5000"},
+		{"REPO_USER", "docker.io", "REPO_USER_DOCKER_IO"},
+	}
+
+	for _, c := range cases {
+		if got := envKeyFor(c.base, c.server); got != c.want {
+			t.Errorf("envKeyFor(%q, %q) = %q, want %q", c.base, c.server, got, c.want)
+		}
+	}
+}
+
+func TestRegistryAuthFromJSON(t *testing.T) {
+	raw := `{
+		"ghcr.io": {"username": "u1", "password": "p1"},
+		"*.gcr.io": {"username": "u2", "password": "p2"}
+	}`
+
+	cases := []struct {
+		server    string
+		wantFound bool
+		wantUser  string
+	}{
+		{"ghcr.io", true, "u1"},
+		{"us.gcr.io", true, "u2"},
+		{"docker.io", false, ""},
+	}
+
+	for _, c := range cases {
+		auth, ok := registryAuthFromJSON(raw, c.server)
+		if ok != c.wantFound {
+			t.Errorf("registryAuthFromJSON(%q) found = %v, want %v", c.server, ok, c.wantFound)
+			continue
+		}
+		if ok && auth.Username != c.wantUser {
+			t.Errorf("registryAuthFromJSON(%q).Username = %q, want %q", c.server, auth.Username, c.wantUser)
+		}
+	}
+
+	if _, ok := registryAuthFromJSON("", "ghcr.io"); ok {
+		t.Error("registryAuthFromJSON(\"\", ...) should find nothing")
+	}
+	if _, ok := registryAuthFromJSON("not json", "ghcr.io"); ok {
+		t.Error("registryAuthFromJSON with invalid JSON should find nothing")
+	}
+}
+
+func TestCredentialHelperOnPath(t *testing.T) {
+	if credentialHelperOnPath("definitely-not-a-real-watchtower-credential-helper") {
+		t.Error("credentialHelperOnPath should be false for a helper that isn't installed")
+	}
+}
+
+func TestAuthFromEnvNoCredentials(t *testing.T) {
+	auth, err := authFromEnv()("docker.io/library/ubuntu")
+	if err != nil || auth != nil {
+		t.Errorf("authFromEnv() with nothing configured = (%v, %v), want (nil, nil)", auth, err)
+	}
+}
+
+func TestAuthFromEnvBareFallback(t *testing.T) {
+	t.Setenv("REPO_USER", "bare-user")
+	t.Setenv("REPO_PASS", "bare-pass")
+
+	auth, err := authFromEnv()("docker.io/library/ubuntu")
+	if err != nil {
+		t.Fatalf("authFromEnv() error = %s", err)
+	}
+	if auth == nil || auth.Username != "bare-user" || auth.Password != "bare-pass" {
+		t.Errorf("authFromEnv() = %+v, want Username=bare-user Password=bare-pass", auth)
+	}
+}
+
+func TestAuthFromEnvPerHostOverridesBare(t *testing.T) {
+	t.Setenv("REPO_USER", "bare-user")
+	t.Setenv("REPO_PASS", "bare-pass")
+	t.Setenv(envKeyFor("REPO_USER", "ghcr.io"), "ghcr-user")
+	t.Setenv(envKeyFor("REPO_PASS", "ghcr.io"), "ghcr-pass")
+
+	auth, err := authFromEnv()("ghcr.io/library/ubuntu")
+	if err != nil {
+		t.Fatalf("authFromEnv() error = %s", err)
+	}
+	if auth == nil || auth.Username != "ghcr-user" || auth.Password != "ghcr-pass" {
+		t.Errorf("authFromEnv() = %+v, want the per-host ghcr.io credentials", auth)
+	}
+
+	// The bare pair should still resolve for a host with no override.
+	auth, err = authFromEnv()("docker.io/library/ubuntu")
+	if err != nil {
+		t.Fatalf("authFromEnv() error = %s", err)
+	}
+	if auth == nil || auth.Username != "bare-user" {
+		t.Errorf("authFromEnv() fallback = %+v, want the bare REPO_USER/REPO_PASS pair", auth)
+	}
+}
+
+func TestAuthFromEnvJSONOverridesPerHost(t *testing.T) {
+	t.Setenv(envKeyFor("REPO_USER", "ghcr.io"), "env-user")
+	t.Setenv(envKeyFor("REPO_PASS", "ghcr.io"), "env-pass")
+	t.Setenv(registryAuthsEnv, `{"ghcr.io": {"username": "json-user", "password": "json-pass"}}`)
+
+	auth, err := authFromEnv()("ghcr.io/library/ubuntu")
+	if err != nil {
+		t.Fatalf("authFromEnv() error = %s", err)
+	}
+	if auth == nil || auth.Username != "json-user" {
+		t.Errorf("authFromEnv() = %+v, want WATCHTOWER_REGISTRY_AUTHS to win over per-host env vars", auth)
+	}
+}
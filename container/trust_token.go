@@ -0,0 +1,208 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/docker/api/types"
+)
+
+// tokenCacheEntry holds a bearer token obtained from a registry's OAuth2
+// token endpoint, along with when it stops being useful.
+type tokenCacheEntry struct {
+	token  string
+	expiry time.Time
+}
+
+var (
+	tokenCacheMu sync.Mutex
+	tokenCache   = map[string]tokenCacheEntry{}
+)
+
+// bearerChallenge is the parsed form of a
+// `WWW-Authenticate: Bearer realm="...",service="...",scope="..."` header,
+// as returned by ECR, GCR, GHCR, Harbor and Quay robot accounts when a
+// request is rejected for lack of a short-lived token.
+type bearerChallenge struct {
+	Realm   string
+	Service string
+	Scope   string
+}
+
+// cacheKey identifies a cached token by the registry and scope it's good for.
+func (c *bearerChallenge) cacheKey() string {
+	return c.Service + "|" + c.Scope
+}
+
+// parseBearerChallenge extracts realm/service/scope from a WWW-Authenticate
+// header value. It returns false if the header isn't a Bearer challenge.
+func parseBearerChallenge(header string) (*bearerChallenge, bool) {
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, false
+	}
+	challenge := &bearerChallenge{}
+	for _, field := range strings.Split(strings.TrimPrefix(header, "Bearer "), ",") {
+		parts := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.Trim(parts[1], `"`)
+		switch strings.ToLower(parts[0]) {
+		case "realm":
+			challenge.Realm = value
+		case "service":
+			challenge.Service = value
+		case "scope":
+			challenge.Scope = value
+		}
+	}
+	if challenge.Realm == "" {
+		return nil, false
+	}
+	return challenge, true
+}
+
+// cachedBearerToken returns a still-valid cached token for key, evicting it
+// first if it has expired so the cache doesn't grow unbounded with stale
+// entries across scans.
+func cachedBearerToken(key string) (string, bool) {
+	tokenCacheMu.Lock()
+	defer tokenCacheMu.Unlock()
+	cached, ok := tokenCache[key]
+	if !ok {
+		return "", false
+	}
+	if time.Now().Before(cached.expiry) {
+		return cached.token, true
+	}
+	delete(tokenCache, key)
+	return "", false
+}
+
+// fetchBearerToken exchanges credentials (a username/password pair, or an
+// identity token handed back by a credential helper) for a short-lived
+// bearer token at the challenge's realm, caching it until it expires.
+func fetchBearerToken(challenge *bearerChallenge, auth *types.AuthConfig) (string, error) {
+	if token, ok := cachedBearerToken(challenge.cacheKey()); ok {
+		return token, nil
+	}
+
+	reqURL, err := url.Parse(challenge.Realm)
+	if err != nil {
+		return "", err
+	}
+	query := reqURL.Query()
+	if challenge.Service != "" {
+		query.Set("service", challenge.Service)
+	}
+	if challenge.Scope != "" {
+		query.Set("scope", challenge.Scope)
+	}
+	if auth.IdentityToken != "" {
+		query.Set("grant_type", "refresh_token")
+		query.Set("refresh_token", auth.IdentityToken)
+	}
+	reqURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if auth.IdentityToken == "" && auth.Username != "" {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token exchange with %s failed: %s", challenge.Realm, resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	token := body.Token
+	if token == "" {
+		token = body.AccessToken
+	}
+	expiresIn := body.ExpiresIn
+	if expiresIn <= 0 {
+		expiresIn = 60
+	}
+
+	tokenCacheMu.Lock()
+	tokenCache[challenge.cacheKey()] = tokenCacheEntry{
+		token:  token,
+		expiry: time.Now().Add(time.Duration(expiresIn) * time.Second),
+	}
+	tokenCacheMu.Unlock()
+
+	return token, nil
+}
+
+// AuthHandler returns a docker registry.RequestPrivilegeFunc-compatible
+// retry callback (func() (string, error), the exact shape DefaultAuthHandler
+// satisfies) for ref, to be registered as PrivilegeFunc in its place.
+// Docker's PrivilegeFunc runs with no access to the failed pull's response,
+// so rather than requiring the caller to supply the 401's WWW-Authenticate
+// header, the returned closure re-probes the registry itself for its
+// challenge on invocation, performs the token-exchange dance against the
+// challenge's realm, and rewrites X-Registry-Auth with the resulting bearer
+// token via RegistryToken; it falls back to DefaultAuthHandler's anonymous
+// retry if the registry doesn't require bearer auth or the exchange fails.
+func AuthHandler(ref string) func() (string, error) {
+	return func() (string, error) {
+		server, err := ParseServerAddress(ref)
+		if err != nil {
+			return DefaultAuthHandler()
+		}
+
+		challenge, ok := probeBearerChallenge(server)
+		if !ok {
+			return DefaultAuthHandler()
+		}
+
+		auth, err := firstValidAuth(ref, authBackends())
+		if err != nil || auth == nil {
+			return DefaultAuthHandler()
+		}
+
+		token, err := fetchBearerToken(challenge, auth)
+		if err != nil {
+			log.Debugf("Token exchange failed, falling back to anonymous: %s", err)
+			return DefaultAuthHandler()
+		}
+
+		return EncodeAuth(&types.AuthConfig{RegistryToken: token})
+	}
+}
+
+// probeBearerChallenge makes an unauthenticated request to server's /v2/
+// endpoint and parses any WWW-Authenticate challenge off the resulting 401,
+// the same way registry clients themselves discover where to fetch tokens
+// from before a credentialed request is ever made.
+func probeBearerChallenge(server string) (*bearerChallenge, bool) {
+	resp, err := http.Get("https://" + server + "/v2/")
+	if err != nil {
+		return nil, false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		return nil, false
+	}
+	return parseBearerChallenge(resp.Header.Get("WWW-Authenticate"))
+}
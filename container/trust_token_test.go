@@ -0,0 +1,69 @@
+package container
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBearerChallenge(t *testing.T) {
+	cases := []struct {
+		header    string
+		wantOK    bool
+		challenge bearerChallenge
+	}{
+		{
+			header: `Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/ubuntu:pull"`,
+			wantOK: true,
+			challenge: bearerChallenge{
+				Realm:   "https://auth.docker.io/token",
+				Service: "registry.docker.io",
+				Scope:   "repository:library/ubuntu:pull",
+			},
+		},
+		{
+			header: `Bearer realm="https://ghcr.io/token"`,
+			wantOK: true,
+			challenge: bearerChallenge{
+				Realm: "https://ghcr.io/token",
+			},
+		},
+		{header: `Basic realm="registry"`, wantOK: false},
+		{header: "", wantOK: false},
+	}
+
+	for _, c := range cases {
+		got, ok := parseBearerChallenge(c.header)
+		if ok != c.wantOK {
+			t.Errorf("parseBearerChallenge(%q) ok = %v, want %v", c.header, ok, c.wantOK)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if *got != c.challenge {
+			t.Errorf("parseBearerChallenge(%q) = %+v, want %+v", c.header, *got, c.challenge)
+		}
+	}
+}
+
+func TestCachedBearerTokenEvictsExpired(t *testing.T) {
+	tokenCacheMu.Lock()
+	tokenCache["valid"] = tokenCacheEntry{token: "still-good", expiry: time.Now().Add(time.Minute)}
+	tokenCache["expired"] = tokenCacheEntry{token: "stale", expiry: time.Now().Add(-time.Minute)}
+	tokenCacheMu.Unlock()
+
+	if token, ok := cachedBearerToken("valid"); !ok || token != "still-good" {
+		t.Errorf("cachedBearerToken(valid) = (%q, %v), want (\"still-good\", true)", token, ok)
+	}
+
+	if token, ok := cachedBearerToken("expired"); ok {
+		t.Errorf("cachedBearerToken(expired) = (%q, true), want not found", token)
+	}
+
+	tokenCacheMu.Lock()
+	_, stillPresent := tokenCache["expired"]
+	tokenCacheMu.Unlock()
+	if stillPresent {
+		t.Error("expired entry should have been evicted from tokenCache")
+	}
+}